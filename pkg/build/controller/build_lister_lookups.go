@@ -0,0 +1,22 @@
+package controller
+
+import (
+	buildapi "github.com/openshift/origin/pkg/build/api"
+	oscache "github.com/openshift/origin/pkg/client/cache"
+)
+
+// BuildsForBuildConfig returns the Builds owned by buildConfig. Controllers that need to answer
+// "give me all Builds owned by BuildConfig X" (e.g. when pruning builds for a deleted
+// BuildConfig, or enforcing successfulBuildsHistoryLimit/failedBuildsHistoryLimit) should use
+// this instead of scanning every Build in the lister's store.
+func BuildsForBuildConfig(lister *oscache.StoreToBuildLister, buildConfig *buildapi.BuildConfig) ([]*buildapi.Build, error) {
+	return lister.ListByBuildConfig(buildConfig.Namespace, buildConfig.Name)
+}
+
+// BuildsTriggeredByImageStreamTag returns the Builds triggered by the ImageStreamTag named
+// imageStreamTagName in namespace. Controllers reacting to an ImageStream update (e.g. to report
+// which in-flight Builds were started in response to a particular tag change) should use this
+// instead of scanning every Build in the lister's store.
+func BuildsTriggeredByImageStreamTag(lister *oscache.StoreToBuildLister, namespace, imageStreamTagName string) ([]*buildapi.Build, error) {
+	return lister.ListByTriggerImageStream(namespace, imageStreamTagName)
+}
@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"fmt"
+
+	buildapi "github.com/openshift/origin/pkg/build/api"
+)
+
+const (
+	// BuildConfigIndex indexes Builds by the BuildConfig that owns them, so that controllers can
+	// answer "give me all Builds owned by BuildConfig X" without a full store scan.
+	BuildConfigIndex = "buildconfig"
+
+	// TriggerCauseIndex indexes Builds by the type of trigger that caused them (e.g.
+	// "ImageChange", "ConfigChange", "GenericWebHook", "GitHubWebHook", "Manual").
+	TriggerCauseIndex = "triggerCause"
+
+	// PhaseIndex indexes Builds by their current phase, for queue-length metrics.
+	PhaseIndex = "phase"
+)
+
+// BuildConfigIndexFunc indexes Builds by "namespace/buildconfig-name", read from the
+// BuildConfigLabel label (or, for legacy builds that predate the label, the BuildConfigAnnotation
+// annotation).
+func BuildConfigIndexFunc(obj interface{}) ([]string, error) {
+	build, ok := obj.(*buildapi.Build)
+	if !ok {
+		return nil, fmt.Errorf("expected a *buildapi.Build, got %T", obj)
+	}
+
+	bcName := build.Labels[buildapi.BuildConfigLabel]
+	if len(bcName) == 0 {
+		bcName = build.Annotations[buildapi.BuildConfigAnnotation]
+	}
+	if len(bcName) == 0 {
+		return []string{}, nil
+	}
+
+	return []string{build.Namespace + "/" + bcName}, nil
+}
+
+// TriggerCauseIndexFunc indexes Builds by the type of each trigger cause recorded in
+// build.Spec.TriggeredBy. A Build may be indexed under more than one key if it recorded more
+// than one cause.
+func TriggerCauseIndexFunc(obj interface{}) ([]string, error) {
+	build, ok := obj.(*buildapi.Build)
+	if !ok {
+		return nil, fmt.Errorf("expected a *buildapi.Build, got %T", obj)
+	}
+
+	keys := []string{}
+	for _, cause := range build.Spec.TriggeredBy {
+		keys = append(keys, triggerCauseType(cause))
+	}
+
+	return keys, nil
+}
+
+// PhaseIndexFunc indexes Builds by their current status phase.
+func PhaseIndexFunc(obj interface{}) ([]string, error) {
+	build, ok := obj.(*buildapi.Build)
+	if !ok {
+		return nil, fmt.Errorf("expected a *buildapi.Build, got %T", obj)
+	}
+
+	return []string{string(build.Status.Phase)}, nil
+}
+
+// triggerCauseType returns a short, stable name for the kind of trigger that produced a
+// BuildTriggerCause, suitable for use as a TriggerCauseIndex key. Neither a ConfigChange nor a
+// Manual cause has a dedicated sub-struct on BuildTriggerCause, so those two are told apart by
+// cause.Message rather than by falling through to a single shared default.
+func triggerCauseType(cause buildapi.BuildTriggerCause) string {
+	switch {
+	case cause.ImageChangeBuild != nil:
+		return "ImageChange"
+	case cause.GenericWebHook != nil:
+		return "GenericWebHook"
+	case cause.GitHubWebHook != nil:
+		return "GitHubWebHook"
+	case cause.GitLabWebHook != nil:
+		return "GitLabWebHook"
+	case cause.BitbucketWebHook != nil:
+		return "BitbucketWebHook"
+	case cause.Message == buildapi.BuildTriggerCauseConfigMsg:
+		return "ConfigChange"
+	default:
+		return "Manual"
+	}
+}
+
+// ListByBuildConfig returns all Builds owned by the BuildConfig named name in namespace, using
+// the BuildConfigIndex.
+func (s *StoreToBuildLister) ListByBuildConfig(namespace, name string) ([]*buildapi.Build, error) {
+	items, err := s.Indexer.ByIndex(BuildConfigIndex, namespace+"/"+name)
+	if err != nil {
+		return nil, err
+	}
+
+	builds := make([]*buildapi.Build, 0, len(items))
+	for _, item := range items {
+		builds = append(builds, item.(*buildapi.Build))
+	}
+	return builds, nil
+}
+
+// ListByTriggerImageStream returns all Builds in namespace that were triggered by the
+// ImageStreamTag isTag, narrowing the search with TriggerCauseIndex before filtering on the
+// specific tag.
+func (s *StoreToBuildLister) ListByTriggerImageStream(namespace, isTag string) ([]*buildapi.Build, error) {
+	items, err := s.Indexer.ByIndex(TriggerCauseIndex, "ImageChange")
+	if err != nil {
+		return nil, err
+	}
+
+	builds := []*buildapi.Build{}
+	for _, item := range items {
+		build := item.(*buildapi.Build)
+		if build.Namespace != namespace {
+			continue
+		}
+
+		for _, cause := range build.Spec.TriggeredBy {
+			if cause.ImageChangeBuild == nil || cause.ImageChangeBuild.FromRef == nil {
+				continue
+			}
+			if cause.ImageChangeBuild.FromRef.Name == isTag {
+				builds = append(builds, build)
+				break
+			}
+		}
+	}
+
+	return builds, nil
+}
@@ -0,0 +1,209 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	kapi "k8s.io/kubernetes/pkg/api"
+
+	buildapi "github.com/openshift/origin/pkg/build/api"
+)
+
+func newIndexedBuildStore() cache.Indexer {
+	return cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+		BuildConfigIndex:  BuildConfigIndexFunc,
+		TriggerCauseIndex: TriggerCauseIndexFunc,
+		PhaseIndex:        PhaseIndexFunc,
+	})
+}
+
+func imageChangeTriggeredBuild(namespace, name, bcName, isTagName string) *buildapi.Build {
+	return &buildapi.Build{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+			Labels:    map[string]string{buildapi.BuildConfigLabel: bcName},
+		},
+		Status: buildapi.BuildStatus{Phase: buildapi.BuildPhaseNew},
+		Spec: buildapi.BuildSpec{
+			TriggeredBy: []buildapi.BuildTriggerCause{
+				{ImageChangeBuild: &buildapi.ImageChangeCause{FromRef: &kapi.ObjectReference{Name: isTagName}}},
+			},
+		},
+	}
+}
+
+func TestBuildConfigIndexFunc(t *testing.T) {
+	labeled := imageChangeTriggeredBuild("ns", "build-1", "bc1", "some-tag:latest")
+	legacy := &buildapi.Build{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "build-2", Annotations: map[string]string{buildapi.BuildConfigAnnotation: "bc2"}},
+	}
+	untracked := &buildapi.Build{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "build-3"}}
+
+	for name, build := range map[string]struct {
+		build *buildapi.Build
+		want  []string
+	}{
+		"label":     {labeled, []string{"ns/bc1"}},
+		"legacy":    {legacy, []string{"ns/bc2"}},
+		"untracked": {untracked, []string{}},
+	} {
+		keys, err := BuildConfigIndexFunc(build.build)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if !stringSliceEqual(keys, build.want) {
+			t.Fatalf("%s: expected keys %v, got %v", name, build.want, keys)
+		}
+	}
+}
+
+func TestTriggerCauseIndexFunc(t *testing.T) {
+	imageChange := imageChangeTriggeredBuild("ns", "build-1", "bc1", "some-tag:latest")
+	configChange := &buildapi.Build{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "build-2"},
+		Spec:       buildapi.BuildSpec{TriggeredBy: []buildapi.BuildTriggerCause{{Message: buildapi.BuildTriggerCauseConfigMsg}}},
+	}
+	manual := &buildapi.Build{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "build-4"},
+		Spec:       buildapi.BuildSpec{TriggeredBy: []buildapi.BuildTriggerCause{{Message: buildapi.BuildTriggerCauseManualMsg}}},
+	}
+	webhook := &buildapi.Build{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "build-3"},
+		Spec:       buildapi.BuildSpec{TriggeredBy: []buildapi.BuildTriggerCause{{GitHubWebHook: &buildapi.GitHubWebHookCause{}}}},
+	}
+
+	for name, tc := range map[string]struct {
+		build *buildapi.Build
+		want  []string
+	}{
+		"image change":  {imageChange, []string{"ImageChange"}},
+		"config change": {configChange, []string{"ConfigChange"}},
+		"manual":        {manual, []string{"Manual"}},
+		"webhook":       {webhook, []string{"GitHubWebHook"}},
+	} {
+		keys, err := TriggerCauseIndexFunc(tc.build)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if !stringSliceEqual(keys, tc.want) {
+			t.Fatalf("%s: expected keys %v, got %v", name, tc.want, keys)
+		}
+	}
+}
+
+func TestPhaseIndexFunc(t *testing.T) {
+	build := &buildapi.Build{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "build-1"},
+		Status:     buildapi.BuildStatus{Phase: buildapi.BuildPhaseComplete},
+	}
+
+	keys, err := PhaseIndexFunc(build)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !stringSliceEqual(keys, []string{string(buildapi.BuildPhaseComplete)}) {
+		t.Fatalf("expected phase key, got %v", keys)
+	}
+}
+
+func TestListByBuildConfig(t *testing.T) {
+	indexer := newIndexedBuildStore()
+	for _, b := range []*buildapi.Build{
+		imageChangeTriggeredBuild("ns", "build-1", "bc1", "tag1:latest"),
+		imageChangeTriggeredBuild("ns", "build-2", "bc1", "tag1:latest"),
+		imageChangeTriggeredBuild("ns", "build-3", "bc2", "tag1:latest"),
+		imageChangeTriggeredBuild("other-ns", "build-4", "bc1", "tag1:latest"),
+	} {
+		if err := indexer.Add(b); err != nil {
+			t.Fatalf("unexpected error adding build: %v", err)
+		}
+	}
+
+	lister := &StoreToBuildLister{Indexer: indexer}
+	builds, err := lister.ListByBuildConfig("ns", "bc1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(builds) != 2 {
+		t.Fatalf("expected 2 builds owned by ns/bc1, got %d", len(builds))
+	}
+}
+
+func TestListByTriggerImageStream(t *testing.T) {
+	indexer := newIndexedBuildStore()
+	for _, b := range []*buildapi.Build{
+		imageChangeTriggeredBuild("ns", "build-1", "bc1", "tag1:latest"),
+		imageChangeTriggeredBuild("ns", "build-2", "bc1", "tag2:latest"),
+		imageChangeTriggeredBuild("other-ns", "build-3", "bc1", "tag1:latest"),
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "build-4"}},
+	} {
+		if err := indexer.Add(b); err != nil {
+			t.Fatalf("unexpected error adding build: %v", err)
+		}
+	}
+
+	lister := &StoreToBuildLister{Indexer: indexer}
+	builds, err := lister.ListByTriggerImageStream("ns", "tag1:latest")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(builds) != 1 || builds[0].Name != "build-1" {
+		t.Fatalf("expected only build-1 to match ns/tag1:latest, got %#v", builds)
+	}
+}
+
+func stringSliceEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// linearListByBuildConfig is the full-store scan that ListByBuildConfig replaces, kept here only
+// to benchmark the improvement the new BuildConfigIndex provides.
+func linearListByBuildConfig(builds []*buildapi.Build, namespace, name string) []*buildapi.Build {
+	matches := []*buildapi.Build{}
+	for _, b := range builds {
+		if b.Namespace == namespace && b.Labels[buildapi.BuildConfigLabel] == name {
+			matches = append(matches, b)
+		}
+	}
+	return matches
+}
+
+func buildBenchmarkFixture(n int) (indexer cache.Indexer, flat []*buildapi.Build) {
+	indexer = newIndexedBuildStore()
+	flat = make([]*buildapi.Build, 0, n)
+	for i := 0; i < n; i++ {
+		bcName := fmt.Sprintf("bc-%d", i%50)
+		build := imageChangeTriggeredBuild("ns", fmt.Sprintf("build-%d", i), bcName, "tag1:latest")
+		indexer.Add(build)
+		flat = append(flat, build)
+	}
+	return indexer, flat
+}
+
+func BenchmarkListByBuildConfigLinearScan(b *testing.B) {
+	_, flat := buildBenchmarkFixture(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		linearListByBuildConfig(flat, "ns", "bc-7")
+	}
+}
+
+func BenchmarkListByBuildConfigIndexed(b *testing.B) {
+	indexer, _ := buildBenchmarkFixture(10000)
+	lister := &StoreToBuildLister{Indexer: indexer}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lister.ListByBuildConfig("ns", "bc-7")
+	}
+}
@@ -45,7 +45,13 @@ func (f *buildInformer) Informer() cache.SharedIndexInformer {
 		},
 		informerObj,
 		f.defaultResync,
-		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc, oscache.ImageStreamReferenceIndex: oscache.ImageStreamReferenceIndexFunc},
+		cache.Indexers{
+			cache.NamespaceIndex:              cache.MetaNamespaceIndexFunc,
+			oscache.ImageStreamReferenceIndex: oscache.ImageStreamReferenceIndexFunc,
+			oscache.BuildConfigIndex:          oscache.BuildConfigIndexFunc,
+			oscache.TriggerCauseIndex:         oscache.TriggerCauseIndexFunc,
+			oscache.PhaseIndex:                oscache.PhaseIndexFunc,
+		},
 	)
 	f.informers[informerType] = informer
 
@@ -0,0 +1,32 @@
+package api
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/kubernetes/pkg/apis/autoscaling"
+)
+
+// ScaleFromConfigAutoscaling returns an autoscaling/v1-shaped scale subresource for a deployment
+// config. It mirrors ScaleFromConfig, but serializes the label selector to a string in
+// Status.Selector as expected by autoscaling/v1 clients such as the
+// HorizontalPodAutoscaler controller, instead of the map[string]string used by extensions.Scale.
+func ScaleFromConfigAutoscaling(config *DeploymentConfig) *autoscaling.Scale {
+	selector := labels.SelectorFromSet(config.Spec.Selector).String()
+
+	return &autoscaling.Scale{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              config.Name,
+			Namespace:         config.Namespace,
+			UID:               config.UID,
+			ResourceVersion:   config.ResourceVersion,
+			CreationTimestamp: config.CreationTimestamp,
+		},
+		Spec: autoscaling.ScaleSpec{
+			Replicas: config.Spec.Replicas,
+		},
+		Status: autoscaling.ScaleStatus{
+			Replicas: config.Status.Replicas,
+			Selector: selector,
+		},
+	}
+}
@@ -6,11 +6,14 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	apirequest "k8s.io/apiserver/pkg/endpoints/request"
 	"k8s.io/apiserver/pkg/registry/generic"
 	"k8s.io/apiserver/pkg/registry/generic/registry"
 	"k8s.io/apiserver/pkg/registry/rest"
 	kapi "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/apis/autoscaling"
+	autoscalingvalidation "k8s.io/kubernetes/pkg/apis/autoscaling/validation"
 	"k8s.io/kubernetes/pkg/apis/extensions"
 	extvalidation "k8s.io/kubernetes/pkg/apis/extensions/validation"
 
@@ -64,11 +67,35 @@ type ScaleREST struct {
 // ScaleREST implements Patcher
 var _ = rest.Patcher(&ScaleREST{})
 
+// ScaleREST implements GroupVersionKindProvider so that the apiserver can serve this
+// subresource as either extensions/v1beta1.Scale (legacy clients, e.g. `kubectl scale`) or
+// autoscaling/v1.Scale (e.g. the HorizontalPodAutoscaler controller), depending on which group
+// the request came in through.
+var _ = rest.GroupVersionKindProvider(&ScaleREST{})
+
+// GroupVersionKind returns the canonical Kind this endpoint serves for the given containing
+// group version.
+func (r *ScaleREST) GroupVersionKind(containingGV schema.GroupVersion) schema.GroupVersionKind {
+	switch containingGV {
+	case extensions.SchemeGroupVersion:
+		return extensions.SchemeGroupVersion.WithKind("Scale")
+	default:
+		return autoscaling.SchemeGroupVersion.WithKind("Scale")
+	}
+}
+
 // New creates a new Scale object
 func (r *ScaleREST) New() runtime.Object {
 	return &extensions.Scale{}
 }
 
+// isAutoscalingRequest returns true if the incoming request was made against the autoscaling
+// API group rather than the legacy extensions group.
+func isAutoscalingRequest(ctx apirequest.Context) bool {
+	info, ok := apirequest.RequestInfoFrom(ctx)
+	return ok && info.APIGroup == autoscaling.GroupName
+}
+
 // Get retrieves (computes) the Scale subresource for the given DeploymentConfig name.
 func (r *ScaleREST) Get(ctx apirequest.Context, name string, options *metav1.GetOptions) (runtime.Object, error) {
 	deploymentConfig, err := r.registry.GetDeploymentConfig(ctx, name, options)
@@ -76,6 +103,9 @@ func (r *ScaleREST) Get(ctx apirequest.Context, name string, options *metav1.Get
 		return nil, err
 	}
 
+	if isAutoscalingRequest(ctx) {
+		return api.ScaleFromConfigAutoscaling(deploymentConfig), nil
+	}
 	return api.ScaleFromConfig(deploymentConfig), nil
 }
 
@@ -86,6 +116,10 @@ func (r *ScaleREST) Update(ctx apirequest.Context, name string, objInfo rest.Upd
 		return nil, false, errors.NewNotFound(extensions.Resource("scale"), name)
 	}
 
+	if isAutoscalingRequest(ctx) {
+		return r.updateAutoscaling(ctx, deploymentConfig, objInfo)
+	}
+
 	old := api.ScaleFromConfig(deploymentConfig)
 	obj, err := objInfo.UpdatedObject(ctx, old)
 	if err != nil {
@@ -109,6 +143,32 @@ func (r *ScaleREST) Update(ctx apirequest.Context, name string, objInfo rest.Upd
 	return scale, false, nil
 }
 
+// updateAutoscaling handles Update for clients submitting an autoscaling/v1.Scale, such as the
+// HorizontalPodAutoscaler controller.
+func (r *ScaleREST) updateAutoscaling(ctx apirequest.Context, deploymentConfig *api.DeploymentConfig, objInfo rest.UpdatedObjectInfo) (runtime.Object, bool, error) {
+	old := api.ScaleFromConfigAutoscaling(deploymentConfig)
+	obj, err := objInfo.UpdatedObject(ctx, old)
+	if err != nil {
+		return nil, false, err
+	}
+
+	scale, ok := obj.(*autoscaling.Scale)
+	if !ok {
+		return nil, false, errors.NewBadRequest(fmt.Sprintf("wrong object passed to Scale update: %v", obj))
+	}
+
+	if errs := autoscalingvalidation.ValidateScale(scale); len(errs) > 0 {
+		return nil, false, errors.NewInvalid(autoscaling.Kind("Scale"), scale.Name, errs)
+	}
+
+	deploymentConfig.Spec.Replicas = scale.Spec.Replicas
+	if err := r.registry.UpdateDeploymentConfig(ctx, deploymentConfig); err != nil {
+		return nil, false, err
+	}
+
+	return scale, false, nil
+}
+
 // StatusREST implements the REST endpoint for changing the status of a DeploymentConfig.
 type StatusREST struct {
 	store *registry.Store
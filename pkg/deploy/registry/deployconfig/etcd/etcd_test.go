@@ -0,0 +1,152 @@
+package etcd
+
+import (
+	"fmt"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	apirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
+	kapi "k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/apis/autoscaling"
+	"k8s.io/kubernetes/pkg/apis/extensions"
+
+	"github.com/openshift/origin/pkg/deploy/api"
+	"github.com/openshift/origin/pkg/deploy/registry/deployconfig"
+)
+
+// fakeDeploymentConfigRegistry is an in-memory deployconfig.Registry used to drive ScaleREST in
+// tests without standing up an etcd-backed generic.Store. It implements only the Get and Update
+// methods that ScaleREST calls; the other Registry methods come from the nil embedded interface
+// and panic if called. updateConflictsRemaining lets tests
+// simulate the apiserver's Patcher retrying Update with a freshly fetched old object after a
+// resourceVersion conflict, the same way concurrent scale requests (e.g. from the HPA controller
+// racing a `kubectl scale`) would.
+type fakeDeploymentConfigRegistry struct {
+	deployconfig.Registry
+
+	config                   *api.DeploymentConfig
+	updateConflictsRemaining int
+	updateCalls              int
+}
+
+func (r *fakeDeploymentConfigRegistry) GetDeploymentConfig(ctx apirequest.Context, name string, options *metav1.GetOptions) (*api.DeploymentConfig, error) {
+	if r.config == nil || r.config.Name != name {
+		return nil, errors.NewNotFound(api.Resource("deploymentconfigs"), name)
+	}
+	configCopy := *r.config
+	return &configCopy, nil
+}
+
+func (r *fakeDeploymentConfigRegistry) UpdateDeploymentConfig(ctx apirequest.Context, config *api.DeploymentConfig) error {
+	r.updateCalls++
+	if r.updateConflictsRemaining > 0 {
+		r.updateConflictsRemaining--
+		return errors.NewConflict(api.Resource("deploymentconfigs"), config.Name, fmt.Errorf("stale resourceVersion"))
+	}
+	r.config = config
+	return nil
+}
+
+func contextForGroup(apiGroup string) apirequest.Context {
+	ctx := apirequest.NewContext()
+	return apirequest.WithRequestInfo(ctx, &apirequest.RequestInfo{APIGroup: apiGroup, Resource: "deploymentconfigs", Subresource: "scale"})
+}
+
+func TestScaleRESTGroupVersionKind(t *testing.T) {
+	scaleREST := &ScaleREST{}
+
+	if got := scaleREST.GroupVersionKind(extensions.SchemeGroupVersion); got != extensions.SchemeGroupVersion.WithKind("Scale") {
+		t.Fatalf("expected extensions Scale for the extensions group, got %v", got)
+	}
+	if got := scaleREST.GroupVersionKind(autoscaling.SchemeGroupVersion); got != autoscaling.SchemeGroupVersion.WithKind("Scale") {
+		t.Fatalf("expected autoscaling Scale for the autoscaling group, got %v", got)
+	}
+}
+
+func TestScaleRESTGetServesBothGroupVersions(t *testing.T) {
+	registry := &fakeDeploymentConfigRegistry{config: &api.DeploymentConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "deploy1", Namespace: "ns"},
+		Spec:       api.DeploymentConfigSpec{Replicas: 2},
+	}}
+	scaleREST := &ScaleREST{registry: registry}
+
+	extObj, err := scaleREST.Get(contextForGroup(extensions.GroupName), "deploy1", &metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error fetching extensions scale: %v", err)
+	}
+	if _, ok := extObj.(*extensions.Scale); !ok {
+		t.Fatalf("expected *extensions.Scale for an extensions-group request, got %T", extObj)
+	}
+
+	autoscalingObj, err := scaleREST.Get(contextForGroup(autoscaling.GroupName), "deploy1", &metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error fetching autoscaling scale: %v", err)
+	}
+	if _, ok := autoscalingObj.(*autoscaling.Scale); !ok {
+		t.Fatalf("expected *autoscaling.Scale for an autoscaling-group request, got %T", autoscalingObj)
+	}
+}
+
+// TestScaleRESTUpdatePatchesReplicasExactlyOnceUnderConflict PATCHes the scale subresource via
+// both group versions and verifies that, even though the first couple of Update attempts hit a
+// conflict (as if another client updated the DeploymentConfig concurrently), the
+// DeploymentConfig's Spec.Replicas ends up updated to the requested value exactly once each time
+// - never doubly-applied, and never lost.
+func TestScaleRESTUpdatePatchesReplicasExactlyOnceUnderConflict(t *testing.T) {
+	tests := []struct {
+		name     string
+		apiGroup string
+	}{
+		{name: "extensions", apiGroup: extensions.GroupName},
+		{name: "autoscaling", apiGroup: autoscaling.GroupName},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			registry := &fakeDeploymentConfigRegistry{
+				config: &api.DeploymentConfig{
+					ObjectMeta: metav1.ObjectMeta{Name: "deploy1", Namespace: "ns"},
+					Spec:       api.DeploymentConfigSpec{Replicas: 1},
+				},
+				updateConflictsRemaining: 2,
+			}
+			scaleREST := &ScaleREST{registry: registry}
+			ctx := contextForGroup(test.apiGroup)
+
+			scaleMeta := metav1.ObjectMeta{Name: "deploy1", Namespace: "ns"}
+			var newScaleObj runtime.Object
+			if test.apiGroup == autoscaling.GroupName {
+				newScaleObj = &autoscaling.Scale{ObjectMeta: scaleMeta, Spec: autoscaling.ScaleSpec{Replicas: 3}}
+			} else {
+				newScaleObj = &extensions.Scale{ObjectMeta: scaleMeta, Spec: extensions.ScaleSpec{Replicas: 3}}
+			}
+			objInfo := rest.DefaultUpdatedObjectInfo(newScaleObj, kapi.Scheme)
+
+			// Simulate the apiserver's Patcher retrying Update after each conflict, re-fetching
+			// the DeploymentConfig fresh each time just like ScaleREST.Update already does.
+			var lastErr error
+			for attempt := 0; attempt < 3; attempt++ {
+				_, _, lastErr = scaleREST.Update(ctx, "deploy1", objInfo)
+				if lastErr == nil {
+					break
+				}
+				if !errors.IsConflict(lastErr) {
+					t.Fatalf("attempt %d: unexpected error: %v", attempt, lastErr)
+				}
+			}
+			if lastErr != nil {
+				t.Fatalf("update never succeeded: %v", lastErr)
+			}
+
+			if registry.config.Spec.Replicas != 3 {
+				t.Fatalf("expected Spec.Replicas to be updated to 3 exactly once, got %d", registry.config.Spec.Replicas)
+			}
+			if registry.updateCalls != 3 {
+				t.Fatalf("expected exactly 3 UpdateDeploymentConfig calls (2 conflicts + 1 success), got %d", registry.updateCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package controllers
+
+import (
+	kclientset "k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset"
+
+	"github.com/openshift/origin/pkg/controller/shared"
+)
+
+// DockercfgControllerOptions bundles the options needed to start the dockercfg-related
+// ServiceAccount secret controllers together.
+type DockercfgControllerOptions struct {
+	DockercfgDeletedControllerOptions
+	DockercfgOrphanedTokenControllerOptions
+}
+
+// RunDockercfgControllers constructs the DockercfgDeletedController and its companion
+// DockercfgOrphanedTokenController and runs both until stopCh is closed. Startup code should
+// call this rather than constructing DockercfgDeletedController on its own, so that orphaned
+// token secrets are always reaped alongside deleted-dockercfg cleanup.
+func RunDockercfgControllers(cl kclientset.Interface, secrets shared.SecretInformer, serviceAccounts shared.ServiceAccountInformer, options DockercfgControllerOptions, workers int, stopCh <-chan struct{}) {
+	orphaned := NewDockercfgOrphanedTokenController(secrets, serviceAccounts, cl, options.DockercfgOrphanedTokenControllerOptions)
+	go orphaned.Run(workers, stopCh)
+
+	deleted := NewDockercfgDeletedController(cl, options.DockercfgDeletedControllerOptions)
+	deleted.Run(workers, stopCh)
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
 
 	kapierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -14,14 +15,38 @@ import (
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/client-go/util/workqueue"
 	"k8s.io/kubernetes/pkg/api"
 	kclientset "k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset"
+
+	// for side effect of registering workqueue metrics with prometheus
+	_ "k8s.io/client-go/util/workqueue/prometheus"
 )
 
 // NumServiceAccountUpdateRetries controls the number of times we will retry on conflict errors.
 // This happens when multiple service account controllers update at the same time.
 const NumServiceAccountUpdateRetries = 10
 
+var dockercfgDeletedControllerRetries = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "openshift",
+	Subsystem: "dockercfg_deleted_controller",
+	Name:      "retries_total",
+	Help:      "Number of times a dockercfg deleted controller sync retried after a conflict.",
+})
+
+var dockercfgDeletedControllerDrops = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "openshift",
+	Subsystem: "dockercfg_deleted_controller",
+	Name:      "drops_total",
+	Help:      "Number of work items the dockercfg deleted controller gave up on and dropped.",
+})
+
+func init() {
+	prometheus.MustRegister(dockercfgDeletedControllerRetries)
+	prometheus.MustRegister(dockercfgDeletedControllerDrops)
+}
+
 // DockercfgDeletedControllerOptions contains options for the DockercfgDeletedController
 type DockercfgDeletedControllerOptions struct {
 	// Resync is the time.Duration at which to fully re-list secrets.
@@ -29,14 +54,27 @@ type DockercfgDeletedControllerOptions struct {
 	Resync time.Duration
 }
 
+// dockercfgSecretWorkItem carries the bits of a dockercfg secret that are needed to clean up
+// the ServiceAccount references and the backing token secret once the dockercfg secret itself
+// is gone. It is queued in place of the deleted secret because, by the time a worker picks it
+// up, the secret (and its annotations) may no longer be retrievable from the API.
+type dockercfgSecretWorkItem struct {
+	namespace           string
+	dockercfgSecretName string
+	tokenSecretName     string
+	serviceAccountName  string
+	serviceAccountUID   string
+}
+
 // NewDockercfgDeletedController returns a new *DockercfgDeletedController.
 func NewDockercfgDeletedController(cl kclientset.Interface, options DockercfgDeletedControllerOptions) *DockercfgDeletedController {
 	e := &DockercfgDeletedController{
 		client: cl,
+		queue:  workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "dockercfg_deleted"),
 	}
 
 	dockercfgSelector := fields.OneTermEqualSelector(api.SecretTypeField, string(api.SecretTypeDockercfg))
-	_, e.secretController = cache.NewInformer(
+	e.secretIndexer, e.secretController = cache.NewIndexerInformer(
 		&cache.ListWatch{
 			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
 				opts := metav1.ListOptions{FieldSelector: dockercfgSelector.String()}
@@ -50,8 +88,11 @@ func NewDockercfgDeletedController(cl kclientset.Interface, options DockercfgDel
 		&api.Secret{},
 		options.Resync,
 		cache.ResourceEventHandlerFuncs{
-			DeleteFunc: e.secretDeleted,
+			AddFunc:    e.enqueueSecret,
+			UpdateFunc: func(oldObj, newObj interface{}) { e.enqueueSecret(newObj) },
+			DeleteFunc: e.enqueueSecret,
 		},
+		cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
 	)
 
 	return e
@@ -60,119 +101,178 @@ func NewDockercfgDeletedController(cl kclientset.Interface, options DockercfgDel
 // The DockercfgDeletedController watches for service account dockercfg secrets to be deleted
 // It removes the corresponding token secret and service account references.
 type DockercfgDeletedController struct {
-	stopChan chan struct{}
-
 	client kclientset.Interface
 
+	secretIndexer    cache.Indexer
 	secretController cache.Controller
+
+	queue workqueue.RateLimitingInterface
 }
 
-// Runs controller loops and returns immediately
-func (e *DockercfgDeletedController) Run() {
-	if e.stopChan == nil {
-		e.stopChan = make(chan struct{})
-		go e.secretController.Run(e.stopChan)
+// Run begins watching and syncing, spawning the given number of worker goroutines, and blocks
+// until stopCh is closed.
+func (e *DockercfgDeletedController) Run(workers int, stopCh <-chan struct{}) {
+	defer utilruntime.HandleCrash()
+	defer e.queue.ShutDown()
+
+	glog.Infof("Starting DockercfgDeletedController controller")
+	defer glog.Infof("Shutting down DockercfgDeletedController controller")
+
+	go e.secretController.Run(stopCh)
+
+	if !cache.WaitForCacheSync(stopCh, e.secretController.HasSynced) {
+		return
 	}
-}
 
-// Stop gracefully shuts down this controller
-func (e *DockercfgDeletedController) Stop() {
-	if e.stopChan != nil {
-		close(e.stopChan)
-		e.stopChan = nil
+	for i := 0; i < workers; i++ {
+		go wait.Until(e.worker, time.Second, stopCh)
 	}
+
+	<-stopCh
 }
 
-// secretDeleted reacts to a Secret being deleted by looking to see if it's a dockercfg secret for a service account, in which case it
-// it removes the references from the service account and removes the token created to back the dockercfgSecret
-func (e *DockercfgDeletedController) secretDeleted(obj interface{}) {
+// enqueueSecret extracts the bits of a dockercfg secret needed to reconcile it and, if it is a
+// dockercfg secret backing a ServiceAccount token, adds them to the queue. It is used for
+// AddFunc, UpdateFunc and DeleteFunc alike. syncSecret only cleans up after a dockercfg secret
+// that is no longer in the informer's cache when a worker picks up the item, so an Add or Update
+// item leads to cleanup only if the secret is deleted before it is processed; a dockercfg secret
+// deleted while the controller was not running produces no event and is not cleaned up.
+func (e *DockercfgDeletedController) enqueueSecret(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
 	dockercfgSecret, ok := obj.(*api.Secret)
 	if !ok {
 		return
 	}
-	if _, exists := dockercfgSecret.Annotations[ServiceAccountTokenSecretNameKey]; !exists {
+
+	tokenSecretName, exists := dockercfgSecret.Annotations[ServiceAccountTokenSecretNameKey]
+	if !exists {
 		return
 	}
 
-	for i := 1; i <= NumServiceAccountUpdateRetries; i++ {
-		if err := e.removeDockercfgSecretReference(dockercfgSecret); err != nil {
-			if kapierrors.IsConflict(err) && i < NumServiceAccountUpdateRetries {
-				time.Sleep(wait.Jitter(100*time.Millisecond, 0.0))
-				continue
-			}
+	e.queue.Add(dockercfgSecretWorkItem{
+		namespace:           dockercfgSecret.Namespace,
+		dockercfgSecretName: dockercfgSecret.Name,
+		tokenSecretName:     tokenSecretName,
+		serviceAccountName:  dockercfgSecret.Annotations[api.ServiceAccountNameKey],
+		serviceAccountUID:   dockercfgSecret.Annotations[api.ServiceAccountUIDKey],
+	})
+}
 
-			glog.Error(err)
-			break
-		}
+func (e *DockercfgDeletedController) worker() {
+	for e.processNextWorkItem() {
+	}
+}
 
-		break
+func (e *DockercfgDeletedController) processNextWorkItem() bool {
+	key, quit := e.queue.Get()
+	if quit {
+		return false
 	}
+	defer e.queue.Done(key)
 
-	// remove the reference token secret
-	if err := e.client.Core().Secrets(dockercfgSecret.Namespace).Delete(dockercfgSecret.Annotations[ServiceAccountTokenSecretNameKey], nil); (err != nil) && !kapierrors.IsNotFound(err) {
-		utilruntime.HandleError(err)
+	item := key.(dockercfgSecretWorkItem)
+	if err := e.syncSecret(item); err != nil {
+		if e.queue.NumRequeues(key) < NumServiceAccountUpdateRetries {
+			dockercfgDeletedControllerRetries.Inc()
+			e.queue.AddRateLimited(key)
+			return true
+		}
+
+		dockercfgDeletedControllerDrops.Inc()
+		utilruntime.HandleError(fmt.Errorf("dropping dockercfg secret %s/%s out of the queue: %v", item.namespace, item.dockercfgSecretName, err))
 	}
+
+	e.queue.Forget(key)
+	return true
 }
 
-// removeDockercfgSecretReference updates the given ServiceAccount to remove ImagePullSecret and Secret references
-func (e *DockercfgDeletedController) removeDockercfgSecretReference(dockercfgSecret *api.Secret) error {
-	serviceAccount, err := e.getServiceAccount(dockercfgSecret)
-	if kapierrors.IsNotFound(err) {
-		// if the service account is gone, no work to do
-		return nil
-	}
+// syncSecret reacts to a dockercfg secret being deleted by looking to see if it's still
+// referenced from its ServiceAccount, in which case it removes the references from the service
+// account and removes the token secret that was created to back the dockercfg secret. Items are
+// also queued for Add and Update notifications (see enqueueSecret), so syncSecret first checks
+// that the dockercfg secret is actually gone; otherwise an Add-sourced item - notably the initial
+// List fired for every dockercfg secret already in the cluster at controller startup - would tear
+// down a ServiceAccount's references and delete its just-created token secret.
+func (e *DockercfgDeletedController) syncSecret(item dockercfgSecretWorkItem) error {
+	exists, err := e.dockercfgSecretExists(item.namespace, item.dockercfgSecretName)
 	if err != nil {
 		return err
 	}
+	if exists {
+		return nil
+	}
 
-	changed := false
-
-	secrets := []api.ObjectReference{}
-	for _, s := range serviceAccount.Secrets {
-		if s.Name == dockercfgSecret.Name {
-			changed = true
-			continue
-		}
+	if err := e.removeDockercfgSecretReference(item); err != nil {
+		return err
+	}
 
-		secrets = append(secrets, s)
+	// remove the reference token secret
+	if err := e.client.Core().Secrets(item.namespace).Delete(item.tokenSecretName, nil); err != nil && !kapierrors.IsNotFound(err) {
+		return err
 	}
-	serviceAccount.Secrets = secrets
 
-	imagePullSecrets := []api.LocalObjectReference{}
-	for _, s := range serviceAccount.ImagePullSecrets {
-		if s.Name == dockercfgSecret.Name {
-			changed = true
-			continue
-		}
+	return nil
+}
 
-		imagePullSecrets = append(imagePullSecrets, s)
+// dockercfgSecretExists reports whether the dockercfg secret named name still exists in
+// namespace, consulting e.secretIndexer (the informer's local cache) rather than hitting the API
+// for every sync.
+func (e *DockercfgDeletedController) dockercfgSecretExists(namespace, name string) (bool, error) {
+	_, exists, err := e.secretIndexer.GetByKey(namespace + "/" + name)
+	return exists, err
+}
+
+// removeDockercfgSecretReference updates the given ServiceAccount to remove ImagePullSecret and Secret references
+func (e *DockercfgDeletedController) removeDockercfgSecretReference(item dockercfgSecretWorkItem) error {
+	if len(item.serviceAccountName) == 0 {
+		return nil
 	}
-	serviceAccount.ImagePullSecrets = imagePullSecrets
 
-	if changed {
-		_, err = e.client.Core().ServiceAccounts(dockercfgSecret.Namespace).Update(serviceAccount)
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		serviceAccount, err := e.client.Core().ServiceAccounts(item.namespace).Get(item.serviceAccountName, metav1.GetOptions{})
+		if kapierrors.IsNotFound(err) {
+			// if the service account is gone, no work to do
+			return nil
+		}
 		if err != nil {
 			return err
 		}
-	}
+		if len(item.serviceAccountUID) > 0 && item.serviceAccountUID != string(serviceAccount.UID) {
+			// the service account was deleted and recreated, it can no longer reference this secret
+			return nil
+		}
 
-	return nil
-}
+		changed := false
 
-// getServiceAccount returns the ServiceAccount referenced by the given secret.  return nil, but no error if the secret doesn't reference a service account
-func (e *DockercfgDeletedController) getServiceAccount(secret *api.Secret) (*api.ServiceAccount, error) {
-	saName, saUID := secret.Annotations[api.ServiceAccountNameKey], secret.Annotations[api.ServiceAccountUIDKey]
-	if len(saName) == 0 || len(saUID) == 0 {
-		return nil, nil
-	}
+		secrets := []api.ObjectReference{}
+		for _, s := range serviceAccount.Secrets {
+			if s.Name == item.dockercfgSecretName {
+				changed = true
+				continue
+			}
 
-	serviceAccount, err := e.client.Core().ServiceAccounts(secret.Namespace).Get(saName, metav1.GetOptions{})
-	if err != nil {
-		return nil, err
-	}
+			secrets = append(secrets, s)
+		}
+		serviceAccount.Secrets = secrets
 
-	if saUID != string(serviceAccount.UID) {
-		return nil, fmt.Errorf("secret (%v) service account UID (%v) does not match service account (%v) UID (%v)", secret.Name, saUID, serviceAccount.Name, serviceAccount.UID)
-	}
-	return serviceAccount, nil
+		imagePullSecrets := []api.LocalObjectReference{}
+		for _, s := range serviceAccount.ImagePullSecrets {
+			if s.Name == item.dockercfgSecretName {
+				changed = true
+				continue
+			}
+
+			imagePullSecrets = append(imagePullSecrets, s)
+		}
+		serviceAccount.ImagePullSecrets = imagePullSecrets
+
+		if !changed {
+			return nil
+		}
+
+		_, err = e.client.Core().ServiceAccounts(item.namespace).Update(serviceAccount)
+		return err
+	})
 }
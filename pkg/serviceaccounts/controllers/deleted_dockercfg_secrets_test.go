@@ -0,0 +1,212 @@
+package controllers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	kapierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset/fake"
+	core "k8s.io/kubernetes/pkg/client/testing/core"
+)
+
+func newDockercfgSecret(namespace, name, saName, saUID, tokenSecretName string) *api.Secret {
+	return &api.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+			Annotations: map[string]string{
+				ServiceAccountTokenSecretNameKey: tokenSecretName,
+				api.ServiceAccountNameKey:        saName,
+				api.ServiceAccountUIDKey:         saUID,
+			},
+		},
+		Type: api.SecretTypeDockercfg,
+	}
+}
+
+func TestEnqueueSecretAddUpdateDelete(t *testing.T) {
+	controller := NewDockercfgDeletedController(fake.NewSimpleClientset(), DockercfgDeletedControllerOptions{})
+
+	secret := newDockercfgSecret("ns", "dockercfg-secret", "builder", "the-uid", "builder-token")
+	staleSecret := newDockercfgSecret("ns", "dockercfg-secret", "builder", "the-uid", "builder-token")
+	staleSecret.Annotations[api.ServiceAccountNameKey] = "stale-value-that-must-not-be-used"
+
+	// These mirror exactly how the cache.ResourceEventHandlerFuncs registered in
+	// NewDockercfgDeletedController invoke enqueueSecret for each event type.
+	addFunc := controller.enqueueSecret
+	updateFunc := func(oldObj, newObj interface{}) { controller.enqueueSecret(newObj) }
+	deleteFunc := controller.enqueueSecret
+
+	for name, enqueue := range map[string]func(){
+		"add":    func() { addFunc(secret) },
+		"update": func() { updateFunc(staleSecret, secret) },
+		"delete": func() { deleteFunc(secret) },
+	} {
+		enqueue()
+
+		key, quit := controller.queue.Get()
+		if quit {
+			t.Fatalf("%s: queue unexpectedly shut down", name)
+		}
+		item, ok := key.(dockercfgSecretWorkItem)
+		if !ok {
+			t.Fatalf("%s: expected dockercfgSecretWorkItem, got %T", name, key)
+		}
+		if item.namespace != "ns" || item.dockercfgSecretName != "dockercfg-secret" || item.tokenSecretName != "builder-token" || item.serviceAccountName != "builder" || item.serviceAccountUID != "the-uid" {
+			t.Fatalf("%s: unexpected work item: %#v", name, item)
+		}
+		controller.queue.Done(key)
+		controller.queue.Forget(key)
+	}
+}
+
+func TestEnqueueSecretIgnoresNonDockercfgSecrets(t *testing.T) {
+	controller := NewDockercfgDeletedController(fake.NewSimpleClientset(), DockercfgDeletedControllerOptions{})
+
+	controller.enqueueSecret(&api.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "opaque-secret"}})
+
+	if controller.queue.Len() != 0 {
+		t.Fatalf("expected no work item to be queued for a secret with no token annotation, got %d", controller.queue.Len())
+	}
+}
+
+// TestRemoveDockercfgSecretReferenceConflictStorm simulates several concurrent
+// DockercfgDeletedControllers racing to update the same ServiceAccount: the fake clientset
+// returns a conflict error on the first few Update calls before succeeding, and
+// removeDockercfgSecretReference is expected to retry with a fresh Get each time rather than
+// reusing a stale ServiceAccount object, eventually succeeding.
+func TestRemoveDockercfgSecretReferenceConflictStorm(t *testing.T) {
+	conflictsRemaining := 3
+
+	client := fake.NewSimpleClientset(&api.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "builder"},
+		Secrets:    []api.ObjectReference{{Name: "dockercfg-secret"}},
+	})
+	client.PrependReactor("update", "serviceaccounts", func(action core.Action) (bool, runtime.Object, error) {
+		if conflictsRemaining > 0 {
+			conflictsRemaining--
+			return true, nil, kapierrors.NewConflict(api.Resource("serviceaccounts"), "builder", fmt.Errorf("concurrent controller update"))
+		}
+		return false, nil, nil
+	})
+
+	controller := &DockercfgDeletedController{client: client}
+
+	item := dockercfgSecretWorkItem{
+		namespace:           "ns",
+		dockercfgSecretName: "dockercfg-secret",
+		tokenSecretName:     "builder-token",
+		serviceAccountName:  "builder",
+	}
+
+	// removeDockercfgSecretReference is exercised directly here, bypassing syncSecret's
+	// dockercfg-secret-still-exists check, since this test is only concerned with conflict retries.
+	if err := controller.removeDockercfgSecretReference(item); err != nil {
+		t.Fatalf("expected the conflict storm to be retried away, got error: %v", err)
+	}
+	if conflictsRemaining != 0 {
+		t.Fatalf("expected all simulated conflicts to be consumed, %d remain", conflictsRemaining)
+	}
+
+	serviceAccount, err := client.Core().ServiceAccounts("ns").Get("builder", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error fetching service account: %v", err)
+	}
+	if len(serviceAccount.Secrets) != 0 {
+		t.Fatalf("expected the dockercfg secret reference to be removed, got %#v", serviceAccount.Secrets)
+	}
+}
+
+// TestSyncSecretNoopsWhenDockercfgSecretStillExists verifies that syncSecret does not tear down
+// the ServiceAccount's references or delete the token secret for an item that was queued because
+// the dockercfg secret was added or updated (including the initial List at controller startup) -
+// only an item whose dockercfg secret is actually gone should trigger cleanup.
+func TestSyncSecretNoopsWhenDockercfgSecretStillExists(t *testing.T) {
+	dockercfgSecret := newDockercfgSecret("ns", "dockercfg-secret", "builder", "the-uid", "builder-token")
+	tokenSecret := &api.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "builder-token"}}
+	serviceAccount := &api.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "builder", UID: "the-uid"},
+		Secrets:    []api.ObjectReference{{Name: "dockercfg-secret"}},
+	}
+
+	client := fake.NewSimpleClientset(serviceAccount, tokenSecret)
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := indexer.Add(dockercfgSecret); err != nil {
+		t.Fatalf("unexpected error adding to indexer: %v", err)
+	}
+
+	controller := &DockercfgDeletedController{client: client, secretIndexer: indexer}
+
+	item := dockercfgSecretWorkItem{
+		namespace:           "ns",
+		dockercfgSecretName: "dockercfg-secret",
+		tokenSecretName:     "builder-token",
+		serviceAccountName:  "builder",
+		serviceAccountUID:   "the-uid",
+	}
+	if err := controller.syncSecret(item); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	updatedServiceAccount, err := client.Core().ServiceAccounts("ns").Get("builder", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error fetching service account: %v", err)
+	}
+	if len(updatedServiceAccount.Secrets) != 1 {
+		t.Fatalf("expected the service account's secret reference to be untouched, got %#v", updatedServiceAccount.Secrets)
+	}
+	if _, err := client.Core().Secrets("ns").Get("builder-token", metav1.GetOptions{}); err != nil {
+		t.Fatalf("expected the token secret to still exist, got error: %v", err)
+	}
+}
+
+// TestProcessNextWorkItemDropsAfterRetries verifies that a work item which keeps failing is
+// eventually dropped rather than retried forever, and that it is dropped only after it has been
+// requeued NumServiceAccountUpdateRetries times (NumServiceAccountUpdateRetries+1 attempts).
+func TestProcessNextWorkItemDropsAfterRetries(t *testing.T) {
+	client := fake.NewSimpleClientset(&api.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "builder"},
+		Secrets:    []api.ObjectReference{{Name: "dockercfg-secret"}},
+	})
+	client.PrependReactor("update", "serviceaccounts", func(action core.Action) (bool, runtime.Object, error) {
+		return true, nil, kapierrors.NewConflict(api.Resource("serviceaccounts"), "builder", fmt.Errorf("always conflicts"))
+	})
+
+	controller := &DockercfgDeletedController{
+		client: client,
+		// empty: the dockercfg secret is not present, as if it had already been deleted
+		secretIndexer: cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{}),
+		// use a near-zero backoff so the test doesn't have to wait out the controller's real
+		// exponential backoff while it exhausts its retries
+		queue: workqueue.NewRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(time.Millisecond, 10*time.Millisecond)),
+	}
+
+	item := dockercfgSecretWorkItem{
+		namespace:           "ns",
+		dockercfgSecretName: "dockercfg-secret",
+		tokenSecretName:     "builder-token",
+		serviceAccountName:  "builder",
+		serviceAccountUID:   "",
+	}
+	controller.queue.Add(item)
+
+	// Every sync of this item conflicts. The item is requeued on each of the first
+	// NumServiceAccountUpdateRetries failures; the following attempt (where NumRequeues has
+	// reached NumServiceAccountUpdateRetries) drops it instead.
+	for i := 0; i < NumServiceAccountUpdateRetries+1; i++ {
+		if !controller.processNextWorkItem() {
+			t.Fatalf("queue shut down unexpectedly on attempt %d", i)
+		}
+	}
+
+	if controller.queue.Len() != 0 {
+		t.Fatalf("expected the work item to have been dropped, but the queue still has %d items", controller.queue.Len())
+	}
+}
@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/prometheus/client_golang/prometheus"
+
+	kapierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/kubernetes/pkg/api"
+	kclientset "k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset"
+
+	"github.com/openshift/origin/pkg/controller/shared"
+)
+
+// NumOrphanDeleteRetries controls the number of times we will retry deleting an orphaned secret
+// after a conflict error. This mirrors the retry behavior of the upstream TokensController.
+const NumOrphanDeleteRetries = 10
+
+var dockercfgOrphanedTokenControllerRetries = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "openshift",
+	Subsystem: "dockercfg_orphaned_token_controller",
+	Name:      "retries_total",
+	Help:      "Number of times a dockercfg orphaned token controller sync retried after a conflict.",
+})
+
+var dockercfgOrphanedTokenControllerDrops = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "openshift",
+	Subsystem: "dockercfg_orphaned_token_controller",
+	Name:      "drops_total",
+	Help:      "Number of work items the dockercfg orphaned token controller gave up on and dropped.",
+})
+
+func init() {
+	prometheus.MustRegister(dockercfgOrphanedTokenControllerRetries)
+	prometheus.MustRegister(dockercfgOrphanedTokenControllerDrops)
+}
+
+// DockercfgOrphanedTokenControllerOptions contains options for the DockercfgOrphanedTokenController
+type DockercfgOrphanedTokenControllerOptions struct {
+	// Resync is the time.Duration at which to fully re-list secrets.
+	// If zero, re-list will be delayed as long as possible
+	Resync time.Duration
+}
+
+// orphanedSecretWorkItem carries the bits of a ServiceAccount token or dockercfg secret needed
+// to delete it once it has been found to be orphaned.
+type orphanedSecretWorkItem struct {
+	namespace string
+	name      string
+	uid       string
+}
+
+// NewDockercfgOrphanedTokenController returns a new *DockercfgOrphanedTokenController.
+func NewDockercfgOrphanedTokenController(secrets shared.SecretInformer, serviceAccounts shared.ServiceAccountInformer, cl kclientset.Interface, options DockercfgOrphanedTokenControllerOptions) *DockercfgOrphanedTokenController {
+	e := &DockercfgOrphanedTokenController{
+		client:                cl,
+		secretCache:           secrets.Informer().GetStore(),
+		secretsSynced:         secrets.Informer().HasSynced,
+		serviceAccountCache:   serviceAccounts.Informer().GetStore(),
+		serviceAccountsSynced: serviceAccounts.Informer().HasSynced,
+		queue:                 workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "dockercfg_orphaned_token"),
+	}
+
+	secrets.Informer().AddEventHandlerWithResyncPeriod(
+		cache.ResourceEventHandlerFuncs{
+			AddFunc:    e.handleSecret,
+			UpdateFunc: func(oldObj, newObj interface{}) { e.handleSecret(newObj) },
+		},
+		options.Resync,
+	)
+
+	return e
+}
+
+// The DockercfgOrphanedTokenController watches ServiceAccount token and dockercfg secrets and
+// deletes the ones whose referenced ServiceAccount has been deleted (or recreated, in which
+// case the UID on the secret no longer matches). This catches secrets orphaned by a direct
+// ServiceAccount deletion, which DockercfgDeletedController cannot see since it only reacts to
+// the dockercfg secret itself going away.
+type DockercfgOrphanedTokenController struct {
+	client kclientset.Interface
+
+	secretCache   cache.Store
+	secretsSynced cache.InformerSynced
+
+	serviceAccountCache   cache.Store
+	serviceAccountsSynced cache.InformerSynced
+
+	queue workqueue.RateLimitingInterface
+}
+
+// Run waits for the informer caches backing this controller to sync, spawns the given number of
+// worker goroutines, and performs a full reconciliation pass so that orphans which accumulated
+// while the controller was down are cleaned up. It blocks until stopCh is closed.
+func (e *DockercfgOrphanedTokenController) Run(workers int, stopCh <-chan struct{}) {
+	defer utilruntime.HandleCrash()
+	defer e.queue.ShutDown()
+
+	glog.Infof("Starting DockercfgOrphanedTokenController controller")
+	defer glog.Infof("Shutting down DockercfgOrphanedTokenController controller")
+
+	if !cache.WaitForCacheSync(stopCh, e.secretsSynced, e.serviceAccountsSynced) {
+		return
+	}
+
+	for i := 0; i < workers; i++ {
+		go wait.Until(e.worker, time.Second, stopCh)
+	}
+
+	for _, obj := range e.secretCache.List() {
+		e.handleSecret(obj)
+	}
+
+	<-stopCh
+}
+
+// handleSecret reacts to a ServiceAccount token or dockercfg secret being added or updated by
+// checking whether the ServiceAccount it references still exists with a matching UID. If not,
+// the secret is orphaned and is queued for deletion. This only enqueues; the actual delete
+// happens on a worker goroutine (see syncOrphanedSecret) so that a conflict retry storm never
+// blocks delivery of the next secret event, the same way DockercfgDeletedController's syncSecret
+// is decoupled from its informer's event-dispatch goroutine.
+func (e *DockercfgOrphanedTokenController) handleSecret(obj interface{}) {
+	secret, ok := obj.(*api.Secret)
+	if !ok {
+		return
+	}
+	if secret.Type != api.SecretTypeServiceAccountToken && secret.Type != api.SecretTypeDockercfg {
+		return
+	}
+
+	saName, saUID := secret.Annotations[api.ServiceAccountNameKey], secret.Annotations[api.ServiceAccountUIDKey]
+	if len(saName) == 0 || len(saUID) == 0 {
+		return
+	}
+
+	if e.serviceAccountExists(secret.Namespace, saName, saUID) {
+		return
+	}
+
+	e.queue.Add(orphanedSecretWorkItem{namespace: secret.Namespace, name: secret.Name, uid: string(secret.UID)})
+}
+
+func (e *DockercfgOrphanedTokenController) worker() {
+	for e.processNextWorkItem() {
+	}
+}
+
+func (e *DockercfgOrphanedTokenController) processNextWorkItem() bool {
+	key, quit := e.queue.Get()
+	if quit {
+		return false
+	}
+	defer e.queue.Done(key)
+
+	item := key.(orphanedSecretWorkItem)
+	if err := e.syncOrphanedSecret(item); err != nil {
+		if e.queue.NumRequeues(key) < NumOrphanDeleteRetries {
+			dockercfgOrphanedTokenControllerRetries.Inc()
+			e.queue.AddRateLimited(key)
+			return true
+		}
+
+		dockercfgOrphanedTokenControllerDrops.Inc()
+		utilruntime.HandleError(fmt.Errorf("dropping orphaned secret %s/%s out of the queue: %v", item.namespace, item.name, err))
+	}
+
+	e.queue.Forget(key)
+	return true
+}
+
+// serviceAccountExists reports whether the ServiceAccount named by namespace/name is present in
+// the informer cache with the given UID.
+func (e *DockercfgOrphanedTokenController) serviceAccountExists(namespace, name, uid string) bool {
+	obj, exists, err := e.serviceAccountCache.GetByKey(namespace + "/" + name)
+	if err != nil || !exists {
+		return false
+	}
+
+	serviceAccount, ok := obj.(*api.ServiceAccount)
+	if !ok {
+		return false
+	}
+
+	return uid == string(serviceAccount.UID)
+}
+
+// syncOrphanedSecret deletes the secret named by item. A conflict (or any other transient error)
+// is handled by processNextWorkItem requeueing the item through the rate-limited queue, rather
+// than blocking the worker goroutine in a retry loop.
+func (e *DockercfgOrphanedTokenController) syncOrphanedSecret(item orphanedSecretWorkItem) error {
+	uid := types.UID(item.uid)
+	err := e.client.Core().Secrets(item.namespace).Delete(item.name, &metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &uid}})
+	if err != nil && !kapierrors.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	kapierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/client/clientset_generated/internalclientset/fake"
+)
+
+func newTokenSecret(namespace, name, saName, saUID string) *api.Secret {
+	return &api.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+			UID:       types.UID(name + "-uid"),
+			Annotations: map[string]string{
+				api.ServiceAccountNameKey: saName,
+				api.ServiceAccountUIDKey:  saUID,
+			},
+		},
+		Type: api.SecretTypeServiceAccountToken,
+	}
+}
+
+func newTestOrphanedTokenController(client *fake.Clientset, serviceAccounts ...*api.ServiceAccount) *DockercfgOrphanedTokenController {
+	serviceAccountCache := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	for _, sa := range serviceAccounts {
+		serviceAccountCache.Add(sa)
+	}
+
+	return &DockercfgOrphanedTokenController{
+		client:                client,
+		secretCache:           cache.NewStore(cache.MetaNamespaceKeyFunc),
+		secretsSynced:         func() bool { return true },
+		serviceAccountCache:   serviceAccountCache,
+		serviceAccountsSynced: func() bool { return true },
+		queue:                 workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "dockercfg_orphaned_token_test"),
+	}
+}
+
+// drainQueue synchronously processes every item currently on the controller's queue, the way
+// running worker goroutines would, without requiring the test to wait on real goroutines.
+func drainQueue(controller *DockercfgOrphanedTokenController) {
+	for controller.queue.Len() > 0 {
+		controller.processNextWorkItem()
+	}
+}
+
+func TestHandleSecretServiceAccountPresentMatchingUID(t *testing.T) {
+	serviceAccount := &api.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "builder", UID: "sa-uid"}}
+	secret := newTokenSecret("ns", "builder-token", "builder", "sa-uid")
+
+	client := fake.NewSimpleClientset(serviceAccount, secret)
+	controller := newTestOrphanedTokenController(client, serviceAccount)
+
+	controller.handleSecret(secret)
+	drainQueue(controller)
+
+	if _, err := client.Core().Secrets("ns").Get("builder-token", metav1.GetOptions{}); err != nil {
+		t.Fatalf("expected the token secret to survive when its ServiceAccount exists with a matching UID, got: %v", err)
+	}
+}
+
+func TestHandleSecretServiceAccountMissing(t *testing.T) {
+	secret := newTokenSecret("ns", "builder-token", "builder", "sa-uid")
+
+	client := fake.NewSimpleClientset(secret)
+	controller := newTestOrphanedTokenController(client) // no ServiceAccount in the cache
+
+	controller.handleSecret(secret)
+	drainQueue(controller)
+
+	_, err := client.Core().Secrets("ns").Get("builder-token", metav1.GetOptions{})
+	if !kapierrors.IsNotFound(err) {
+		t.Fatalf("expected the orphaned token secret to be deleted, got err: %v", err)
+	}
+}
+
+func TestHandleSecretServiceAccountUIDMismatch(t *testing.T) {
+	serviceAccount := &api.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "builder", UID: "new-uid"}}
+	secret := newTokenSecret("ns", "builder-token", "builder", "stale-uid")
+
+	client := fake.NewSimpleClientset(serviceAccount, secret)
+	controller := newTestOrphanedTokenController(client, serviceAccount)
+
+	controller.handleSecret(secret)
+	drainQueue(controller)
+
+	_, err := client.Core().Secrets("ns").Get("builder-token", metav1.GetOptions{})
+	if !kapierrors.IsNotFound(err) {
+		t.Fatalf("expected the stale-UID token secret to be deleted, got err: %v", err)
+	}
+}
+
+// TestRunPerformsFullReconciliationPass verifies that Run walks every cached secret once caches
+// have synced, so orphans that accumulated while the controller was down get cleaned up on
+// startup rather than waiting for the next add/update event.
+func TestRunPerformsFullReconciliationPass(t *testing.T) {
+	orphan := newTokenSecret("ns", "orphan-token", "deleted-sa", "sa-uid")
+	live := newTokenSecret("ns", "live-token", "builder", "sa-uid")
+	serviceAccount := &api.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "builder", UID: "sa-uid"}}
+
+	client := fake.NewSimpleClientset(orphan, live, serviceAccount)
+	controller := newTestOrphanedTokenController(client, serviceAccount)
+	controller.secretCache.Add(orphan)
+	controller.secretCache.Add(live)
+
+	stopCh := make(chan struct{})
+	runDone := make(chan struct{})
+	go func() {
+		controller.Run(1, stopCh)
+		close(runDone)
+	}()
+
+	err := wait.PollImmediate(10*time.Millisecond, time.Second, func() (bool, error) {
+		_, err := client.Core().Secrets("ns").Get("orphan-token", metav1.GetOptions{})
+		return kapierrors.IsNotFound(err), nil
+	})
+	close(stopCh)
+	<-runDone
+
+	if err != nil {
+		t.Fatalf("expected the orphaned secret to be reaped by the startup reconciliation pass: %v", err)
+	}
+	if _, err := client.Core().Secrets("ns").Get("live-token", metav1.GetOptions{}); err != nil {
+		t.Fatalf("expected the live secret to survive the startup reconciliation pass, got err: %v", err)
+	}
+}